@@ -0,0 +1,156 @@
+// Copyright 2021 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rust
+
+import (
+	"fmt"
+	"strings"
+
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	gidlmixer "go.fuchsia.dev/fuchsia/tools/fidl/gidl/mixer"
+	fidl "go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+// BuildValueBorrowed is the entry point for generating Rust expressions that
+// construct a borrowed value, i.e. one shaped for the new Rust bindings'
+// `ValueType::Borrowed` / `ResourceType::Borrowed` associated types rather
+// than the owned bindings built by BuildValue in common.go. Conformance
+// suites that target the new bindings call this instead of BuildValue.
+// Nothing in this package picks between the two builders; the choice is
+// left to the caller.
+func BuildValueBorrowed(value interface{}, decl gidlmixer.Declaration) string {
+	return visitBorrowed(value, decl)
+}
+
+func visitBorrowed(value interface{}, decl gidlmixer.Declaration) string {
+	switch value := value.(type) {
+	case string:
+		var expr string
+		if fidl.PrintableASCII(value) {
+			expr = fmt.Sprintf("%q", value)
+		} else {
+			expr = fmt.Sprintf("std::str::from_utf8(b\"%s\").unwrap()", escapeStr(value))
+		}
+		return wrapNullableBorrowed(decl, expr)
+	case gidlir.Record:
+		switch decl := decl.(type) {
+		case *gidlmixer.StructDecl:
+			return onStructBorrowed(value, decl)
+		case *gidlmixer.TableDecl:
+			return onTableBorrowed(value, decl)
+		case *gidlmixer.UnionDecl:
+			return onUnionBorrowed(value, decl)
+		}
+	case []interface{}:
+		switch decl := decl.(type) {
+		case *gidlmixer.ArrayDecl:
+			return onListBorrowed(value, decl)
+		case *gidlmixer.VectorDecl:
+			return onListBorrowed(value, decl)
+		}
+	case nil:
+		if !decl.IsNullable() {
+			panic(fmt.Sprintf("got nil for non-nullable type: %T", decl))
+		}
+		return "None"
+	}
+	// Bools, integers, floats, bits, enums and handles are borrowed the same
+	// way they are owned (they are Copy types), so fall back to the owned
+	// builder.
+	return buildValueExpr(value, decl)
+}
+
+func wrapNullableBorrowed(decl gidlmixer.Declaration, valueStr string) string {
+	if !decl.IsNullable() {
+		return valueStr
+	}
+	switch decl.(type) {
+	case *gidlmixer.ArrayDecl, *gidlmixer.VectorDecl, *gidlmixer.StringDecl, *gidlmixer.HandleDecl:
+		return fmt.Sprintf("Some(%s)", valueStr)
+	case *gidlmixer.StructDecl, *gidlmixer.UnionDecl:
+		return fmt.Sprintf("Some(&%s)", valueStr)
+	case *gidlmixer.BoolDecl, *gidlmixer.IntegerDecl, *gidlmixer.FloatDecl, *gidlmixer.TableDecl:
+		panic(fmt.Sprintf("decl %v should not be nullable", decl))
+	}
+	panic(fmt.Sprintf("unexpected decl %v", decl))
+}
+
+func onStructBorrowed(value gidlir.Record, decl *gidlmixer.StructDecl) string {
+	var structFields []string
+	providedKeys := make(map[string]struct{}, len(value.Fields))
+	for _, field := range value.Fields {
+		if field.Key.IsUnknown() {
+			panic("unknown field not supported")
+		}
+		providedKeys[field.Key.Name] = struct{}{}
+		fieldName := fidl.ToSnakeCase(field.Key.Name)
+		fieldDecl, ok := decl.Field(field.Key.Name)
+		if !ok {
+			panic(fmt.Sprintf("field %s not found", field.Key.Name))
+		}
+		fieldValueStr := visitBorrowed(field.Value, fieldDecl)
+		structFields = append(structFields, fmt.Sprintf("%s: %s", fieldName, fieldValueStr))
+	}
+	for _, key := range decl.FieldNames() {
+		if _, ok := providedKeys[key]; !ok {
+			fieldName := fidl.ToSnakeCase(key)
+			structFields = append(structFields, fmt.Sprintf("%s: None", fieldName))
+		}
+	}
+	valueStr := fmt.Sprintf("%sRef { %s }", declName(decl), strings.Join(structFields, ", "))
+	return wrapNullableBorrowed(decl, valueStr)
+}
+
+func onTableBorrowed(value gidlir.Record, decl *gidlmixer.TableDecl) string {
+	var builderCalls []string
+	for _, field := range value.Fields {
+		if field.Key.IsUnknown() {
+			panic("unknown field not supported for borrowed values")
+		}
+		fieldName := fidl.ToSnakeCase(field.Key.Name)
+		fieldDecl, ok := decl.Field(field.Key.Name)
+		if !ok {
+			panic(fmt.Sprintf("field %s not found", field.Key.Name))
+		}
+		fieldValueStr := visitBorrowed(field.Value, fieldDecl)
+		builderCalls = append(builderCalls, fmt.Sprintf(".%s(Some(%s))", fieldName, fieldValueStr))
+	}
+	valueStr := fmt.Sprintf("%sBuilder::new()%s.build()", declName(decl), strings.Join(builderCalls, ""))
+	return wrapNullableBorrowed(decl, valueStr)
+}
+
+func onUnionBorrowed(value gidlir.Record, decl *gidlmixer.UnionDecl) string {
+	if len(value.Fields) != 1 {
+		panic(fmt.Sprintf("union has %d fields, expected 1", len(value.Fields)))
+	}
+	field := value.Fields[0]
+	if field.Key.IsUnknown() {
+		panic("unknown variant not supported for borrowed values")
+	}
+	fieldName := fidl.ToUpperCamelCase(field.Key.Name)
+	fieldDecl, ok := decl.Field(field.Key.Name)
+	if !ok {
+		panic(fmt.Sprintf("field %s not found", field.Key.Name))
+	}
+	fieldValueStr := visitBorrowed(field.Value, fieldDecl)
+	valueStr := fmt.Sprintf("%sRef::%s(%s)", declName(decl), fieldName, fieldValueStr)
+	return wrapNullableBorrowed(decl, valueStr)
+}
+
+func onListBorrowed(value []interface{}, decl gidlmixer.ListDeclaration) string {
+	var elements []string
+	elemDecl := decl.Elem()
+	for _, item := range value {
+		elements = append(elements, visitBorrowed(item, elemDecl))
+	}
+	elementsStr := strings.Join(elements, ", ")
+	switch decl.(type) {
+	case *gidlmixer.ArrayDecl:
+		return fmt.Sprintf("[%s]", elementsStr)
+	case *gidlmixer.VectorDecl:
+		return fmt.Sprintf("&[%s]", elementsStr)
+	}
+	panic(fmt.Sprintf("unexpected decl %v", decl))
+}
@@ -24,7 +24,12 @@ func buildHandleDefs(defs []gidlir.HandleDef) string {
 	builder.WriteString("[\n")
 	for i, d := range defs {
 		// Write indices corresponding to the .gidl file handle_defs block.
-		builder.WriteString(fmt.Sprintf("HandleSubtype::%s, // #%d\n", handleTypeName(d.Subtype), i))
+		// rights is the initial set of rights the handle is created with;
+		// buildHandleWithRightsValue reduces from this set with
+		// copy_handle_with_rights when a test case asks for fewer rights.
+		builder.WriteString(fmt.Sprintf(
+			"HandleDef { subtype: HandleSubtype::%s, rights: Rights::from_bits(%d).unwrap() }, // #%d\n",
+			handleTypeName(d.Subtype), d.Rights, i))
 	}
 	builder.WriteString("]")
 	return builder.String()
@@ -92,7 +97,58 @@ func escapeStr(value string) string {
 	return buf.String()
 }
 
-func visit(value interface{}, decl gidlmixer.Declaration) string {
+// rustValueBuilder accumulates `let vN = ...;` statements while walking a
+// GIDL value, mirroring the strings.Builder + newVar/assignNew pattern used
+// by the C++ and HLCPP builders. Building up multi-statement code (rather
+// than one giant expression) lets large structs/tables/unions and vectors
+// span multiple lines as untyped `let` bindings, and lets a handle
+// expression be computed once and reused everywhere it appears in the value.
+type rustValueBuilder struct {
+	strings.Builder
+
+	varidx int
+	// handleVars caches the variable assigned to each distinct handle
+	// expression already emitted, keyed by "<handle index>" for handles
+	// taken as-is and "<handle index>:<rights>" for handles reduced to a
+	// narrower set of rights, so the same expression isn't emitted twice
+	// when a handle appears more than once in a value.
+	handleVars map[string]string
+}
+
+func (b *rustValueBuilder) newVar() string {
+	b.varidx++
+	return fmt.Sprintf("v%d", b.varidx)
+}
+
+func (b *rustValueBuilder) assignNew(expr string) string {
+	newVar := b.newVar()
+	b.WriteString(fmt.Sprintf("let %s = %s;\n", newVar, expr))
+	return newVar
+}
+
+// BuildValue returns Rust statements that build value (assigned to a series
+// of `let` bindings) together with the name of the variable holding the
+// final result, analogous to the (setupCode, exprName) pairs returned by the
+// C++ and HLCPP builders.
+func BuildValue(value interface{}, decl gidlmixer.Declaration) (string, string) {
+	var b rustValueBuilder
+	valueVar := b.visit(value, decl)
+	return b.String(), valueVar
+}
+
+// buildValueExpr returns a single Rust expression for value, wrapping any
+// intermediate `let` statements in a block expression when necessary. It is
+// for callers (e.g. the borrowed and equality builders) that want an inline
+// expression rather than a separate setup/var pair.
+func buildValueExpr(value interface{}, decl gidlmixer.Declaration) string {
+	setup, valueVar := BuildValue(value, decl)
+	if setup == "" {
+		return valueVar
+	}
+	return fmt.Sprintf("{\n%s%s\n}", setup, valueVar)
+}
+
+func (b *rustValueBuilder) visit(value interface{}, decl gidlmixer.Declaration) string {
 	switch value := value.(type) {
 	case bool:
 		return strconv.FormatBool(value)
@@ -102,7 +158,7 @@ func visit(value interface{}, decl gidlmixer.Declaration) string {
 			suffix := primitiveTypeName(decl.Subtype())
 			return fmt.Sprintf("%v%s", value, suffix)
 		case *gidlmixer.BitsDecl:
-			primitive := visit(value, &decl.Underlying)
+			primitive := b.visit(value, &decl.Underlying)
 			if decl.IsFlexible() {
 				return fmt.Sprintf("%s::from_bits_allow_unknown(%v)", declName(decl), primitive)
 			}
@@ -112,7 +168,7 @@ func visit(value interface{}, decl gidlmixer.Declaration) string {
 			// is move validation from the bindings to GIDL.
 			return fmt.Sprintf("unsafe { %s::from_bits_unchecked(%v) }", declName(decl), primitive)
 		case *gidlmixer.EnumDecl:
-			primitive := visit(value, &decl.Underlying)
+			primitive := b.visit(value, &decl.Underlying)
 			if decl.IsFlexible() {
 				return fmt.Sprintf("%s::from_primitive_allow_unknown(%v)", declName(decl), primitive)
 			}
@@ -134,23 +190,26 @@ func visit(value interface{}, decl gidlmixer.Declaration) string {
 		}
 		return wrapNullable(decl, expr)
 	case gidlir.Handle:
-		expr := buildHandleValue(value)
-		return wrapNullable(decl, expr)
+		expr := wrapNullable(decl, b.buildHandleVar(value))
+		return expr
+	case gidlir.HandleWithRights:
+		expr := wrapNullable(decl, b.buildHandleWithRightsVar(value))
+		return expr
 	case gidlir.Record:
 		switch decl := decl.(type) {
 		case *gidlmixer.StructDecl:
-			return onStruct(value, decl)
+			return b.onStruct(value, decl)
 		case *gidlmixer.TableDecl:
-			return onTable(value, decl)
+			return b.onTable(value, decl)
 		case *gidlmixer.UnionDecl:
-			return onUnion(value, decl)
+			return b.onUnion(value, decl)
 		}
 	case []interface{}:
 		switch decl := decl.(type) {
 		case *gidlmixer.ArrayDecl:
-			return onList(value, decl)
+			return b.onList(value, decl)
 		case *gidlmixer.VectorDecl:
-			return onList(value, decl)
+			return b.onList(value, decl)
 		}
 	case nil:
 		if !decl.IsNullable() {
@@ -161,6 +220,38 @@ func visit(value interface{}, decl gidlmixer.Declaration) string {
 	panic(fmt.Sprintf("not implemented: %T", value))
 }
 
+// buildHandleVar returns the variable holding handle, assigning it to a new
+// `let` the first time it's encountered and reusing that variable for every
+// subsequent occurrence of the same handle within the value.
+func (b *rustValueBuilder) buildHandleVar(handle gidlir.Handle) string {
+	key := fmt.Sprintf("%d", handle)
+	if v, ok := b.handleVars[key]; ok {
+		return v
+	}
+	v := b.assignNew(buildHandleValue(handle))
+	b.cacheHandleVar(key, v)
+	return v
+}
+
+// buildHandleWithRightsVar is like buildHandleVar, but for a handle that
+// must be reduced to a narrower set of rights than it was created with.
+func (b *rustValueBuilder) buildHandleWithRightsVar(handle gidlir.HandleWithRights) string {
+	key := fmt.Sprintf("%d:%d", handle.Handle, handle.Rights)
+	if v, ok := b.handleVars[key]; ok {
+		return v
+	}
+	v := b.assignNew(buildHandleWithRightsValue(handle))
+	b.cacheHandleVar(key, v)
+	return v
+}
+
+func (b *rustValueBuilder) cacheHandleVar(key, v string) {
+	if b.handleVars == nil {
+		b.handleVars = make(map[string]string)
+	}
+	b.handleVars[key] = v
+}
+
 func declName(decl gidlmixer.NamedDeclaration) string {
 	return identifierName(decl.Name())
 }
@@ -212,10 +303,60 @@ func handleTypeName(subtype fidl.HandleSubtype) string {
 	switch subtype {
 	case fidl.Handle:
 		return "Handle"
+	case fidl.Bti:
+		return "Bti"
 	case fidl.Channel:
 		return "Channel"
+	case fidl.Clock:
+		return "Clock"
 	case fidl.Event:
 		return "Event"
+	case fidl.Eventpair:
+		return "EventPair"
+	case fidl.Exception:
+		return "Exception"
+	case fidl.Fifo:
+		return "Fifo"
+	case fidl.Guest:
+		return "Guest"
+	case fidl.Interrupt:
+		return "Interrupt"
+	case fidl.Iommu:
+		return "Iommu"
+	case fidl.Job:
+		return "Job"
+	case fidl.Msi:
+		return "Msi"
+	case fidl.Pager:
+		return "Pager"
+	case fidl.PciDevice:
+		return "PciDevice"
+	case fidl.Pmt:
+		return "Pmt"
+	case fidl.Port:
+		return "Port"
+	case fidl.Process:
+		return "Process"
+	case fidl.Profile:
+		return "Profile"
+	case fidl.Resource:
+		return "Resource"
+	case fidl.Socket:
+		return "Socket"
+	case fidl.Stream:
+		return "Stream"
+	case fidl.SuspendToken:
+		return "SuspendToken"
+	case fidl.Thread:
+		return "Thread"
+	case fidl.Timer:
+		return "Timer"
+	case fidl.Vcpu:
+		return "Vcpu"
+	case fidl.Vmar:
+		return "Vmar"
+	case fidl.Vmo:
+		return "Vmo"
 	default:
 		panic(fmt.Sprintf("unsupported handle subtype: %s", subtype))
 	}
@@ -236,7 +377,7 @@ func wrapNullable(decl gidlmixer.Declaration, valueStr string) string {
 	panic(fmt.Sprintf("unexpected decl %v", decl))
 }
 
-func onStruct(value gidlir.Record, decl *gidlmixer.StructDecl) string {
+func (b *rustValueBuilder) onStruct(value gidlir.Record, decl *gidlmixer.StructDecl) string {
 	var structFields []string
 	providedKeys := make(map[string]struct{}, len(value.Fields))
 	for _, field := range value.Fields {
@@ -249,7 +390,7 @@ func onStruct(value gidlir.Record, decl *gidlmixer.StructDecl) string {
 		if !ok {
 			panic(fmt.Sprintf("field %s not found", field.Key.Name))
 		}
-		fieldValueStr := visit(field.Value, fieldDecl)
+		fieldValueStr := b.visit(field.Value, fieldDecl)
 		structFields = append(structFields, fmt.Sprintf("%s: %s", fieldName, fieldValueStr))
 	}
 	for _, key := range decl.FieldNames() {
@@ -259,10 +400,10 @@ func onStruct(value gidlir.Record, decl *gidlmixer.StructDecl) string {
 		}
 	}
 	valueStr := fmt.Sprintf("%s { %s }", declName(decl), strings.Join(structFields, ", "))
-	return wrapNullable(decl, valueStr)
+	return wrapNullable(decl, b.assignNew(valueStr))
 }
 
-func onTable(value gidlir.Record, decl *gidlmixer.TableDecl) string {
+func (b *rustValueBuilder) onTable(value gidlir.Record, decl *gidlmixer.TableDecl) string {
 	var tableFields []string
 	var unknownTuples []string
 	for _, field := range value.Fields {
@@ -277,7 +418,7 @@ func onTable(value gidlir.Record, decl *gidlmixer.TableDecl) string {
 		if !ok {
 			panic(fmt.Sprintf("field %s not found", field.Key.Name))
 		}
-		fieldValueStr := visit(field.Value, fieldDecl)
+		fieldValueStr := b.visit(field.Value, fieldDecl)
 		tableFields = append(tableFields, fmt.Sprintf("%s: Some(%s)", fieldName, fieldValueStr))
 	}
 	if len(unknownTuples) > 0 {
@@ -292,10 +433,10 @@ func onTable(value gidlir.Record, decl *gidlmixer.TableDecl) string {
 	tableName := declName(decl)
 	tableFields = append(tableFields, fmt.Sprintf("..%s::EMPTY", tableName))
 	valueStr := fmt.Sprintf("%s { %s }", tableName, strings.Join(tableFields, ", "))
-	return wrapNullable(decl, valueStr)
+	return wrapNullable(decl, b.assignNew(valueStr))
 }
 
-func onUnion(value gidlir.Record, decl *gidlmixer.UnionDecl) string {
+func (b *rustValueBuilder) onUnion(value gidlir.Record, decl *gidlmixer.UnionDecl) string {
 	if len(value.Fields) != 1 {
 		panic(fmt.Sprintf("union has %d fields, expected 1", len(value.Fields)))
 	}
@@ -315,24 +456,24 @@ func onUnion(value gidlir.Record, decl *gidlmixer.UnionDecl) string {
 		if !ok {
 			panic(fmt.Sprintf("field %s not found", field.Key.Name))
 		}
-		fieldValueStr := visit(field.Value, fieldDecl)
+		fieldValueStr := b.visit(field.Value, fieldDecl)
 		valueStr = fmt.Sprintf("%s::%s(%s)", declName(decl), fieldName, fieldValueStr)
 	}
-	return wrapNullable(decl, valueStr)
+	return wrapNullable(decl, b.assignNew(valueStr))
 }
 
-func onList(value []interface{}, decl gidlmixer.ListDeclaration) string {
+func (b *rustValueBuilder) onList(value []interface{}, decl gidlmixer.ListDeclaration) string {
 	var elements []string
 	elemDecl := decl.Elem()
 	for _, item := range value {
-		elements = append(elements, visit(item, elemDecl))
+		elements = append(elements, b.visit(item, elemDecl))
 	}
 	elementsStr := strings.Join(elements, ", ")
 	switch decl.(type) {
 	case *gidlmixer.ArrayDecl:
 		return fmt.Sprintf("[%s]", elementsStr)
 	case *gidlmixer.VectorDecl:
-		return fmt.Sprintf("vec![%s]", elementsStr)
+		return b.assignNew(fmt.Sprintf("vec![%s]", elementsStr))
 	}
 	panic(fmt.Sprintf("unexpected decl %v", decl))
 }
@@ -340,3 +481,9 @@ func onList(value []interface{}, decl gidlmixer.ListDeclaration) string {
 func buildHandleValue(handle gidlir.Handle) string {
 	return fmt.Sprintf("unsafe { copy_handle(&handle_defs[%d]) }", handle)
 }
+
+func buildHandleWithRightsValue(handle gidlir.HandleWithRights) string {
+	return fmt.Sprintf(
+		"copy_handle_with_rights(&handle_defs[%d], Rights::from_bits(%d).unwrap())",
+		handle.Handle, handle.Rights)
+}
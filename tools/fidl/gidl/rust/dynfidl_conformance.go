@@ -0,0 +1,199 @@
+// Copyright 2021 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rust
+
+import (
+	"fmt"
+	"strings"
+
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	gidlmixer "go.fuchsia.dev/fuchsia/tools/fidl/gidl/mixer"
+	fidl "go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+// dynfidlSkip records why an EncodeSuccess case was skipped rather than
+// turned into a test, mirroring the skip logic in
+// tools/fidl/gidl/dynfidl/conformance.go: the alternative encoder only
+// supports a subset of value shapes, so unsupported cases are recorded
+// instead of silently dropped.
+type dynfidlSkip struct {
+	Name   string
+	Reason string
+}
+
+// GenerateDynfidlConformanceTests generates Rust conformance tests that
+// encode GIDL values using a small, dependency-free encoder (intended for
+// bootloader/no_std contexts) rather than the full generated bindings. Only
+// EncodeSuccess cases are considered, since the alternative encoder has no
+// decoder; cases whose value shape isn't supported by the encoder are
+// skipped with a recorded reason rather than failing the generator.
+// declForValue resolves the top-level declaration for an EncodeSuccess case,
+// the same way the caller already resolves it for the full-bindings
+// backend.
+func GenerateDynfidlConformanceTests(gidl gidlir.All, declForValue func(gidlir.EncodeSuccess) gidlmixer.Declaration) (string, []dynfidlSkip) {
+	var tests strings.Builder
+	var skips []dynfidlSkip
+	for _, encodeSuccess := range gidl.EncodeSuccess {
+		if reason, ok := dynfidlUnsupportedReason(encodeSuccess, declForValue(encodeSuccess)); ok {
+			skips = append(skips, dynfidlSkip{Name: encodeSuccess.Name, Reason: reason})
+			continue
+		}
+		tests.WriteString(generateDynfidlEncodeSuccessTest(encodeSuccess, declForValue(encodeSuccess)))
+	}
+	return tests.String(), skips
+}
+
+// dynfidlUnsupportedReason reports whether encodeSuccess uses a value shape
+// the alternative encoder doesn't support, along with a human-readable
+// reason suitable for a skip comment. The encoder only knows about bools,
+// plain integers and floats, strings, and vectors and structs of those, so
+// anything else -- handles, bits/enums, raw floats, arrays, absent nullable
+// values, tables and unions -- is
+// rejected here rather than being left to panic partway through generation,
+// since one unsupported case anywhere in the corpus must not take down the
+// whole generator run.
+func dynfidlUnsupportedReason(encodeSuccess gidlir.EncodeSuccess, decl gidlmixer.Declaration) (string, bool) {
+	if len(encodeSuccess.HandleDefs) > 0 {
+		return "the alternative encoder does not support handles", true
+	}
+	return dynfidlUnsupportedValueReason(encodeSuccess.Value, decl)
+}
+
+func dynfidlUnsupportedValueReason(value interface{}, decl gidlmixer.Declaration) (string, bool) {
+	switch value := value.(type) {
+	case bool, string:
+		return "", false
+	case int64, uint64, float64:
+		if _, ok := decl.(gidlmixer.PrimitiveDeclaration); ok {
+			return "", false
+		}
+		return fmt.Sprintf("the alternative encoder does not support %T values", decl), true
+	case gidlir.RawFloat:
+		return "the alternative encoder does not support raw (NaN-bearing) floats", true
+	case []interface{}:
+		if _, ok := decl.(*gidlmixer.ArrayDecl); ok {
+			return "the alternative encoder does not support arrays", true
+		}
+		elemDecl := decl.(gidlmixer.ListDeclaration).Elem()
+		// Non-byte integer vectors go through the element-wise vector(...)
+		// path in buildDynfidlField, same as any other vector; only byte
+		// vectors get the dedicated vector_of_bytes(...) shortcut.
+		for _, elem := range value {
+			if reason, ok := dynfidlUnsupportedValueReason(elem, elemDecl); ok {
+				return reason, true
+			}
+		}
+		return "", false
+	case gidlir.Record:
+		structDecl, ok := decl.(*gidlmixer.StructDecl)
+		if !ok {
+			return "the alternative encoder only supports structs, not tables or unions", true
+		}
+		for _, field := range value.Fields {
+			if field.Key.IsUnknown() {
+				return "the alternative encoder does not support unknown fields", true
+			}
+			fieldDecl, ok := structDecl.Field(field.Key.Name)
+			if !ok {
+				panic(fmt.Sprintf("field %s not found", field.Key.Name))
+			}
+			if reason, ok := dynfidlUnsupportedValueReason(field.Value, fieldDecl); ok {
+				return reason, true
+			}
+		}
+		return "", false
+	case nil:
+		return "the alternative encoder does not support nullable fields", true
+	default:
+		return fmt.Sprintf("the alternative encoder does not support %T values", value), true
+	}
+}
+
+func generateDynfidlEncodeSuccessTest(encodeSuccess gidlir.EncodeSuccess, decl gidlmixer.Declaration) string {
+	valueBuild, valueVar := buildDynfidlValue(encodeSuccess.Value, decl)
+	var expectedBytes []string
+	for _, encoding := range encodeSuccess.Encodings {
+		expectedBytes = append(expectedBytes, buildBytes(encoding.Bytes))
+	}
+	return fmt.Sprintf(`
+#[test]
+fn test_%s_dynfidl_encode() {
+    %s
+    let bytes = %s.encode();
+    assert_eq!(bytes, &%s[..]);
+}
+`, testCaseName(encodeSuccess.Name), valueBuild, valueVar, expectedBytes[0])
+}
+
+func testCaseName(gidlName string) string {
+	return strings.ReplaceAll(strings.ToLower(gidlName), ".", "_")
+}
+
+// isUint8Decl reports whether decl is specifically a uint8 integer, the only
+// element type the vector_of_bytes(...) shortcut is valid for -- vectors of
+// wider or signed integers must go through the element-wise vector(...)
+// path instead.
+func isUint8Decl(decl gidlmixer.Declaration) bool {
+	intDecl, ok := decl.(*gidlmixer.IntegerDecl)
+	return ok && intDecl.Subtype() == fidl.Uint8
+}
+
+// buildDynfidlValue walks value the same way BuildValue does, but instead of
+// emitting a typed struct/table/union literal it emits calls into the
+// dynamic encoder's builder API (Encoder::new().struct_(...).vector_of_bytes
+// (...).string(...)), since the alternative encoder has no generated types
+// to construct values of.
+func buildDynfidlValue(value interface{}, decl gidlmixer.Declaration) (string, string) {
+	var b strings.Builder
+	b.WriteString("let mut encoder = Encoder::new();\n")
+	buildDynfidlField(&b, "encoder", value, decl)
+	return b.String(), "encoder"
+}
+
+func buildDynfidlField(b *strings.Builder, encoderVar string, value interface{}, decl gidlmixer.Declaration) {
+	switch value := value.(type) {
+	case bool:
+		b.WriteString(fmt.Sprintf("%s.boolean(%v);\n", encoderVar, value))
+	case int64, uint64, float64:
+		if primitiveDecl, ok := decl.(gidlmixer.PrimitiveDeclaration); ok {
+			b.WriteString(fmt.Sprintf("%s.%s(%v);\n", encoderVar, primitiveTypeName(primitiveDecl.Subtype()), value))
+			return
+		}
+		panic(fmt.Sprintf("unsupported numeric decl for dynfidl encoder: %T", decl))
+	case string:
+		b.WriteString(fmt.Sprintf("%s.string(%q);\n", encoderVar, value))
+	case []interface{}:
+		elemDecl := decl.(gidlmixer.ListDeclaration).Elem()
+		if isUint8Decl(elemDecl) {
+			var byteValues []string
+			for _, elem := range value {
+				byteValues = append(byteValues, fmt.Sprintf("%v", elem))
+			}
+			b.WriteString(fmt.Sprintf("%s.vector_of_bytes(vec![%s]);\n", encoderVar, strings.Join(byteValues, ", ")))
+			return
+		}
+		b.WriteString(fmt.Sprintf("%s.vector(|encoder| {\n", encoderVar))
+		for _, elem := range value {
+			buildDynfidlField(b, "encoder", elem, elemDecl)
+		}
+		b.WriteString("});\n")
+	case gidlir.Record:
+		structDecl, ok := decl.(*gidlmixer.StructDecl)
+		if !ok {
+			panic(fmt.Sprintf("dynfidl encoder only supports structs, got %T", decl))
+		}
+		b.WriteString(fmt.Sprintf("%s.struct_(|encoder| {\n", encoderVar))
+		for _, field := range value.Fields {
+			fieldDecl, ok := structDecl.Field(field.Key.Name)
+			if !ok {
+				panic(fmt.Sprintf("field %s not found", field.Key.Name))
+			}
+			buildDynfidlField(b, "encoder", field.Value, fieldDecl)
+		}
+		b.WriteString("});\n")
+	default:
+		panic(fmt.Sprintf("dynfidl encoder does not support value shape: %T", value))
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rust
+
+import (
+	"fmt"
+	"strings"
+
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	gidlmixer "go.fuchsia.dev/fuchsia/tools/fidl/gidl/mixer"
+	fidl "go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+// buildEqualityCheck returns Rust statements that assert expr decodes to
+// value, without requiring value as a whole to be constructible as a
+// PartialEq literal. Parts of the value that are safe to compare with
+// PartialEq (bools, integers, strings, fully-known composites) are checked
+// with a single assert_eq!, while parts that need special handling --
+// raw floats, handles, and unknown table/union data -- are checked
+// field-by-field.
+func buildEqualityCheck(expr string, value gidlir.Value, decl gidlmixer.Declaration) string {
+	var b strings.Builder
+	buildEquality(&b, expr, value, decl)
+	return b.String()
+}
+
+func buildEquality(b *strings.Builder, expr string, value interface{}, decl gidlmixer.Declaration) {
+	if canUsePartialEq(value, decl) {
+		b.WriteString(fmt.Sprintf("assert_eq!(%s, %s);\n", expr, buildValueExpr(value, decl)))
+		return
+	}
+	switch value := value.(type) {
+	case gidlir.RawFloat:
+		switch decl.(*gidlmixer.FloatDecl).Subtype() {
+		case fidl.Float32:
+			b.WriteString(fmt.Sprintf("assert_eq!(%s.to_bits(), %#b);\n", expr, uint32(value)))
+		case fidl.Float64:
+			b.WriteString(fmt.Sprintf("assert_eq!(%s.to_bits(), %#b);\n", expr, uint64(value)))
+		}
+	case gidlir.Handle:
+		buildHandleEquality(b, expr, value, decl)
+	case gidlir.HandleWithRights:
+		buildHandleWithRightsEquality(b, expr, value, decl)
+	case gidlir.Record:
+		switch decl := decl.(type) {
+		case *gidlmixer.StructDecl:
+			buildStructEquality(b, expr, value, decl)
+		case *gidlmixer.TableDecl:
+			buildTableEquality(b, expr, value, decl)
+		case *gidlmixer.UnionDecl:
+			buildUnionEquality(b, expr, value, decl)
+		}
+	case []interface{}:
+		buildListEquality(b, expr, value, decl.(gidlmixer.ListDeclaration))
+	case nil:
+		b.WriteString(fmt.Sprintf("assert!(%s.is_none());\n", expr))
+	default:
+		panic(fmt.Sprintf("not implemented: %T", value))
+	}
+}
+
+// canUsePartialEq reports whether value can be safely compared in full using
+// a single assert_eq! against a literal built by visit, i.e. it does not
+// contain raw floats (NaN doesn't compare equal to itself), handles (which
+// are compared by raw handle value, or by koid and rights for handles with
+// rights, rather than with PartialEq), or unknown table/union data.
+func canUsePartialEq(value interface{}, decl gidlmixer.Declaration) bool {
+	switch value := value.(type) {
+	case gidlir.RawFloat, gidlir.Handle, gidlir.HandleWithRights:
+		return false
+	case gidlir.Record:
+		switch decl := decl.(type) {
+		case *gidlmixer.StructDecl:
+			for _, field := range value.Fields {
+				fieldDecl, _ := decl.Field(field.Key.Name)
+				if !canUsePartialEq(field.Value, fieldDecl) {
+					return false
+				}
+			}
+			return true
+		case *gidlmixer.TableDecl:
+			for _, field := range value.Fields {
+				if field.Key.IsUnknown() {
+					return false
+				}
+				fieldDecl, _ := decl.Field(field.Key.Name)
+				if !canUsePartialEq(field.Value, fieldDecl) {
+					return false
+				}
+			}
+			return true
+		case *gidlmixer.UnionDecl:
+			if value.Fields[0].Key.IsUnknown() {
+				return false
+			}
+			fieldDecl, _ := decl.Field(value.Fields[0].Key.Name)
+			return canUsePartialEq(value.Fields[0].Value, fieldDecl)
+		}
+		return false
+	case []interface{}:
+		elemDecl := decl.(gidlmixer.ListDeclaration).Elem()
+		for _, elem := range value {
+			if !canUsePartialEq(elem, elemDecl) {
+				return false
+			}
+		}
+		return true
+	default:
+		return true
+	}
+}
+
+func buildHandleEquality(b *strings.Builder, expr string, handle gidlir.Handle, decl gidlmixer.Declaration) {
+	if decl.IsNullable() {
+		b.WriteString(fmt.Sprintf(
+			"assert_eq!(%s.as_ref().map(|h| h.raw_handle()), Some(handle_defs[%d].raw_handle()));\n",
+			expr, handle))
+		return
+	}
+	b.WriteString(fmt.Sprintf("assert_eq!(%s.raw_handle(), handle_defs[%d].raw_handle());\n", expr, handle))
+}
+
+func buildHandleWithRightsEquality(b *strings.Builder, expr string, handle gidlir.HandleWithRights, decl gidlmixer.Declaration) {
+	handleExpr := expr
+	if decl.IsNullable() {
+		handleExpr = fmt.Sprintf("%s.as_ref().unwrap()", expr)
+	}
+	b.WriteString(fmt.Sprintf(
+		"assert_eq!(%s.as_handle_ref().get_koid().unwrap(), handle_defs[%d].as_handle_ref().get_koid().unwrap());\n",
+		handleExpr, handle.Handle))
+	b.WriteString(fmt.Sprintf(
+		"assert_eq!(%s.as_handle_ref().basic_info().unwrap().rights, Rights::from_bits(%d).unwrap());\n",
+		handleExpr, handle.Rights))
+}
+
+// buildUnknownDataEquality asserts that bytesExpr/handlesExpr (the bytes and
+// handles of a decoded unknown table field or union variant) match
+// unknownData. Handles are compared individually by raw handle value, since
+// the decoded handle objects themselves won't be PartialEq to handle_defs.
+func buildUnknownDataEquality(b *strings.Builder, bytesExpr, handlesExpr string, unknownData gidlir.UnknownData) {
+	b.WriteString(fmt.Sprintf("assert_eq!(%s, %s);\n", bytesExpr, buildBytes(unknownData.Bytes)))
+	for i, h := range unknownData.Handles {
+		b.WriteString(fmt.Sprintf(
+			"assert_eq!(%s[%d].raw_handle(), handle_defs[%d].raw_handle());\n", handlesExpr, i, h))
+	}
+}
+
+func buildStructEquality(b *strings.Builder, expr string, value gidlir.Record, decl *gidlmixer.StructDecl) {
+	for _, field := range value.Fields {
+		fieldName := fidl.ToSnakeCase(field.Key.Name)
+		fieldDecl, ok := decl.Field(field.Key.Name)
+		if !ok {
+			panic(fmt.Sprintf("field %s not found", field.Key.Name))
+		}
+		buildEquality(b, fmt.Sprintf("%s.%s", expr, fieldName), field.Value, fieldDecl)
+	}
+}
+
+func buildTableEquality(b *strings.Builder, expr string, value gidlir.Record, decl *gidlmixer.TableDecl) {
+	for _, field := range value.Fields {
+		if field.Key.IsUnknown() {
+			unknownData := field.Value.(gidlir.UnknownData)
+			entryExpr := fmt.Sprintf("%s.unknown_data().unwrap().get(&%d).unwrap()", expr, field.Key.UnknownOrdinal)
+			buildUnknownDataEquality(b,
+				fmt.Sprintf("%s.bytes", entryExpr), fmt.Sprintf("%s.handles", entryExpr), unknownData)
+			continue
+		}
+		fieldName := fidl.ToSnakeCase(field.Key.Name)
+		fieldDecl, ok := decl.Field(field.Key.Name)
+		if !ok {
+			panic(fmt.Sprintf("field %s not found", field.Key.Name))
+		}
+		buildEquality(b, fmt.Sprintf("%s.%s.as_ref().unwrap()", expr, fieldName), field.Value, fieldDecl)
+	}
+}
+
+func buildUnionEquality(b *strings.Builder, expr string, value gidlir.Record, decl *gidlmixer.UnionDecl) {
+	field := value.Fields[0]
+	if field.Key.IsUnknown() {
+		unknownData := field.Value.(gidlir.UnknownData)
+		b.WriteString(fmt.Sprintf("assert_eq!(%s.ordinal(), %d);\n", expr, field.Key.UnknownOrdinal))
+		buildUnknownDataEquality(b,
+			fmt.Sprintf("%s.unknown_bytes().unwrap()", expr), fmt.Sprintf("%s.unknown_handles().unwrap()", expr), unknownData)
+		return
+	}
+	fieldName := fidl.ToUpperCamelCase(field.Key.Name)
+	fieldDecl, ok := decl.Field(field.Key.Name)
+	if !ok {
+		panic(fmt.Sprintf("field %s not found", field.Key.Name))
+	}
+	matchedExpr := fmt.Sprintf("inner_value")
+	b.WriteString(fmt.Sprintf("match %s {\n", expr))
+	b.WriteString(fmt.Sprintf("%s::%s(%s) => {\n", declName(decl), fieldName, matchedExpr))
+	buildEquality(b, matchedExpr, field.Value, fieldDecl)
+	b.WriteString("}\n")
+	b.WriteString(fmt.Sprintf("_ => panic!(\"expected %s::%s\"),\n", declName(decl), fieldName))
+	b.WriteString("}\n")
+}
+
+func buildListEquality(b *strings.Builder, expr string, value []interface{}, decl gidlmixer.ListDeclaration) {
+	elemDecl := decl.Elem()
+	for i, elem := range value {
+		buildEquality(b, fmt.Sprintf("%s[%d]", expr, i), elem, elemDecl)
+	}
+}